@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// AudioSample is a chunk of raw interleaved PCM audio captured from the
+// default system/microphone input device.
+type AudioSample struct {
+	Data       []int16
+	SampleRate int
+	Channels   int
+}
+
+// StartAudioCap starts streaming PCM audio samples from the default input
+// device to a channel. Samples are delivered in the fixed-size chunks the
+// audio backend hands back from its capture callback; the consumer is
+// responsible for repacking them into the frame sizes its encoder expects.
+func StartAudioCap(ctx context.Context, sampleRate, channels int, audioChan chan<- *AudioSample) error {
+	if err := portaudio.Initialize(); err != nil {
+		log.Println("Error initializing portaudio:", err)
+		return err
+	}
+	defer portaudio.Terminate()
+
+	// buffer size is arbitrary, the encoder side repacks chunks into its
+	// own frame_size via a FIFO, so this just needs to be reasonably small
+	// to keep capture latency low
+	buf := make([]int16, 1024*channels)
+
+	stream, err := portaudio.OpenDefaultStream(channels, 0, float64(sampleRate), len(buf)/channels, &buf)
+	if err != nil {
+		log.Println("Error opening default audio input stream:", err)
+		return err
+	}
+	defer stream.Close()
+
+	if err := stream.Start(); err != nil {
+		log.Println("Error starting audio input stream:", err)
+		return err
+	}
+	defer stream.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Audio Capture Stream Stopped")
+			return nil
+		default:
+			if err := stream.Read(); err != nil {
+				log.Println("Error reading audio input stream:", err)
+				return err
+			}
+
+			// copy the buffer since portaudio reuses it on the next Read
+			sample := make([]int16, len(buf))
+			copy(sample, buf)
+
+			audioChan <- &AudioSample{Data: sample, SampleRate: sampleRate, Channels: channels}
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"image"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/asticode/go-astiav"
 )
@@ -140,3 +141,187 @@ func NewH264EncoderCodec(width, height, fps int, bitrate int64) (*astiav.Codec,
 	// return
 	return codec, codecCtx, nil
 }
+
+// NewAACEncoderCodec Creates a new AAC Encoder Codec and Encoder Codec Context
+func NewAACEncoderCodec(sampleRate, channels int, bitrate int64) (*astiav.Codec, *astiav.CodecContext, error) {
+	// find aac encoder
+	codec := astiav.FindEncoder(astiav.CodecIDAac)
+	if codec == nil {
+		log.Println("Error finding aac encoder")
+		return nil, nil, errors.New("error finding aac encoder")
+	}
+
+	// allocate codec context
+	codecCtx := astiav.AllocCodecContext(codec)
+	if codecCtx == nil {
+		log.Println("Error allocating audio codec context")
+		return nil, nil, errors.New("error allocating audio codec context")
+	}
+	// !! DO NOT DEFER codecCtx.Free() here, because we will return it
+	//    we don't want to free memory for it here, or it will be set to null
+	//    free it in a higher level function after using it
+
+	// set codec context parameters
+	codecCtx.SetChannelLayout(astiav.ChannelLayoutDefault(channels))
+	codecCtx.SetSampleRate(sampleRate)
+	codecCtx.SetSampleFormat(astiav.SampleFormatFltp)
+	// set time base to 1/sampleRate so sample counts map directly to PTS
+	codecCtx.SetTimeBase(astiav.NewRational(1, sampleRate))
+	// set bitrate
+	codecCtx.SetBitRate(bitrate)
+	// set global header flag
+	codecCtx.SetFlags(codecCtx.Flags().Add(astiav.CodecContextFlagGlobalHeader))
+
+	// return
+	return codec, codecCtx, nil
+}
+
+// audioEncoderState holds everything needed to repack short PCM chunks from
+// the capture callback into fixed frame_size AAC frames and encode them.
+// Mirrors the per-stream struct pattern used by the transcoding example:
+// encCodecContext + encPkt + a resample/FIFO buffer.
+type audioEncoderState struct {
+	codecCtx    *astiav.CodecContext
+	pkt         *astiav.Packet
+	resampleCtx *astiav.SoftwareResampleContext
+	fifo        *astiav.AudioFifo
+	// startTime is the same shared monotonic clock StartScreenRecording
+	// derives video PTS from, so both streams' timestamps originate from
+	// the same instant and lip-sync holds across capture pauses
+	startTime time.Time
+	// samplesSent is the next frame's PTS, in samples. It's anchored to
+	// startTime on the first pullFrame call and then advances by exactly
+	// frameSize per frame after that, so PTS stays monotonic even when
+	// several buffered frames are drained back-to-back with no elapsed
+	// wall-clock time between them.
+	samplesSent int64
+	anchored    bool
+}
+
+// newAudioEncoderState allocates the resampler and FIFO used to convert
+// incoming PCM int16 samples into the codec's sample format and to buffer
+// them until a full frame_size worth of samples is available. startTime is
+// the shared monotonic clock video PTS is also derived from.
+func newAudioEncoderState(codecCtx *astiav.CodecContext, inSampleRate, inChannels int, startTime time.Time) (*audioEncoderState, error) {
+	resampleCtx, err := astiav.AllocSoftwareResampleContext()
+	if err != nil {
+		log.Println("Error allocating software resample context:", err)
+		return nil, err
+	}
+
+	if err := resampleCtx.SetOption("in_sample_rate", inSampleRate); err != nil {
+		return nil, err
+	}
+	if err := resampleCtx.SetOption("out_sample_rate", codecCtx.SampleRate()); err != nil {
+		return nil, err
+	}
+	if err := resampleCtx.SetOption("in_channel_layout", astiav.ChannelLayoutDefault(inChannels)); err != nil {
+		return nil, err
+	}
+	if err := resampleCtx.SetOption("out_channel_layout", codecCtx.ChannelLayout()); err != nil {
+		return nil, err
+	}
+	if err := resampleCtx.SetOption("in_sample_fmt", astiav.SampleFormatS16); err != nil {
+		return nil, err
+	}
+	if err := resampleCtx.SetOption("out_sample_fmt", codecCtx.SampleFormat()); err != nil {
+		return nil, err
+	}
+
+	if err := resampleCtx.Init(); err != nil {
+		log.Println("Error initializing software resample context:", err)
+		return nil, err
+	}
+
+	fifo, err := astiav.AllocAudioFifo(codecCtx.SampleFormat(), codecCtx.ChannelLayout().Channels(), codecCtx.FrameSize())
+	if err != nil {
+		log.Println("Error allocating audio fifo:", err)
+		return nil, err
+	}
+
+	return &audioEncoderState{
+		codecCtx:    codecCtx,
+		pkt:         astiav.AllocPacket(),
+		resampleCtx: resampleCtx,
+		fifo:        fifo,
+		startTime:   startTime,
+	}, nil
+}
+
+// push resamples a raw PCM sample chunk and appends it to the FIFO.
+func (a *audioEncoderState) push(sample *AudioSample) error {
+	srcFrame := astiav.AllocFrame()
+	defer srcFrame.Free()
+
+	srcFrame.SetSampleFormat(astiav.SampleFormatS16)
+	srcFrame.SetChannelLayout(astiav.ChannelLayoutDefault(sample.Channels))
+	srcFrame.SetSampleRate(sample.SampleRate)
+	srcFrame.SetNbSamples(len(sample.Data) / sample.Channels)
+
+	if err := srcFrame.AllocBuffer(0); err != nil {
+		return err
+	}
+	if err := srcFrame.Data().FromInt16Samples(sample.Data); err != nil {
+		return err
+	}
+
+	dstFrame := astiav.AllocFrame()
+	defer dstFrame.Free()
+
+	dstFrame.SetSampleFormat(a.codecCtx.SampleFormat())
+	dstFrame.SetChannelLayout(a.codecCtx.ChannelLayout())
+	dstFrame.SetSampleRate(a.codecCtx.SampleRate())
+
+	if err := a.resampleCtx.ConvertFrame(srcFrame, dstFrame); err != nil {
+		return err
+	}
+
+	return a.fifo.Write(dstFrame)
+}
+
+// pullFrame drains a fixed frame_size worth of samples from the FIFO and
+// returns a frame ready to be sent to the encoder, or nil if not enough
+// samples have accumulated yet.
+func (a *audioEncoderState) pullFrame() (*astiav.Frame, error) {
+	frameSize := a.codecCtx.FrameSize()
+	if a.fifo.Size() < frameSize {
+		return nil, nil
+	}
+
+	frame := astiav.AllocFrame()
+	frame.SetSampleFormat(a.codecCtx.SampleFormat())
+	frame.SetChannelLayout(a.codecCtx.ChannelLayout())
+	frame.SetSampleRate(a.codecCtx.SampleRate())
+	frame.SetNbSamples(frameSize)
+
+	if err := frame.AllocBuffer(0); err != nil {
+		frame.Free()
+		return nil, err
+	}
+
+	if err := a.fifo.Read(frame, frameSize); err != nil {
+		frame.Free()
+		return nil, err
+	}
+
+	// anchor the sample counter to elapsed wall time against the shared
+	// startTime clock only once; every subsequent frame advances it by
+	// exactly frameSize instead of re-deriving PTS from wall-clock, so PTS
+	// stays monotonic even when the FIFO has backlog and this is called
+	// several times in a row with no elapsed time in between
+	if !a.anchored {
+		a.samplesSent = time.Since(a.startTime).Microseconds() * int64(a.codecCtx.SampleRate()) / 1_000_000
+		a.anchored = true
+	}
+	frame.SetPts(a.samplesSent)
+	a.samplesSent += int64(frameSize)
+
+	return frame, nil
+}
+
+// close releases the resources owned by the audio encoder state.
+func (a *audioEncoderState) close() {
+	a.pkt.Free()
+	a.resampleCtx.Free()
+	a.fifo.Free()
+}
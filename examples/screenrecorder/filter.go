@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/asticode/go-astiav"
+)
+
+// FilterPipeline wraps a libavfilter graph between screen capture and the
+// encoder, so callers can insert arbitrary filter chains (drawtext for a
+// watermark, crop, scale, fps, hwupload, ...) without StartScreenRecording
+// having to know about them.
+type FilterPipeline struct {
+	graph         *astiav.FilterGraph
+	buffersrcCtx  *astiav.FilterContext
+	buffersinkCtx *astiav.FilterContext
+}
+
+// NewFilterPipeline builds a "buffer" source and "buffersink" sink around
+// the user-supplied filter description (the same syntax as ffmpeg's
+// -vf/-filter_complex), e.g. "drawtext=text='%{localtime}'" or "crop=800:600".
+// An empty desc yields a pass-through pipeline.
+func NewFilterPipeline(desc string, inWidth, inHeight int, inFmt, outFmt astiav.PixelFormat, timeBase astiav.Rational) (*FilterPipeline, error) {
+	if desc == "" {
+		desc = "null"
+	}
+
+	graph := astiav.AllocFilterGraph()
+	if graph == nil {
+		return nil, fmt.Errorf("error allocating filter graph")
+	}
+
+	buffersrc := astiav.FindFilterByName("buffer")
+	buffersink := astiav.FindFilterByName("buffersink")
+	if buffersrc == nil || buffersink == nil {
+		graph.Free()
+		return nil, fmt.Errorf("error finding buffer/buffersink filters")
+	}
+
+	srcArgs := fmt.Sprintf(
+		"video_size=%dx%d:pix_fmt=%d:time_base=%d/%d:pixel_aspect=1/1",
+		inWidth, inHeight, inFmt, timeBase.Num(), timeBase.Den(),
+	)
+
+	buffersrcCtx, err := graph.NewFilterContext(buffersrc, "in", srcArgs)
+	if err != nil {
+		graph.Free()
+		return nil, fmt.Errorf("error creating buffer source context: %w", err)
+	}
+
+	buffersinkCtx, err := graph.NewFilterContext(buffersink, "out", "")
+	if err != nil {
+		graph.Free()
+		return nil, fmt.Errorf("error creating buffersink context: %w", err)
+	}
+	if err := buffersinkCtx.SetOption("pix_fmts", []astiav.PixelFormat{outFmt}); err != nil {
+		graph.Free()
+		return nil, fmt.Errorf("error setting buffersink pixel format: %w", err)
+	}
+
+	outputs := astiav.AllocFilterInOut()
+	defer outputs.Free()
+	outputs.SetName("in")
+	outputs.SetFilterContext(buffersrcCtx)
+	outputs.SetPadIdx(0)
+	outputs.SetNext(nil)
+
+	inputs := astiav.AllocFilterInOut()
+	defer inputs.Free()
+	inputs.SetName("out")
+	inputs.SetFilterContext(buffersinkCtx)
+	inputs.SetPadIdx(0)
+	inputs.SetNext(nil)
+
+	if err := graph.Parse(desc, inputs, outputs); err != nil {
+		graph.Free()
+		return nil, fmt.Errorf("error parsing filter description %q: %w", desc, err)
+	}
+
+	if err := graph.Configure(); err != nil {
+		graph.Free()
+		return nil, fmt.Errorf("error configuring filter graph: %w", err)
+	}
+
+	return &FilterPipeline{
+		graph:         graph,
+		buffersrcCtx:  buffersrcCtx,
+		buffersinkCtx: buffersinkCtx,
+	}, nil
+}
+
+// PushFrame feeds a frame into the filter graph's buffer source.
+func (f *FilterPipeline) PushFrame(frame *astiav.Frame) error {
+	return f.buffersrcCtx.BuffersrcAddFrame(frame, astiav.NewBuffersrcFlags(astiav.BuffersrcFlagKeepRef))
+}
+
+// PullFrame drains one filtered frame from the buffersink into frame. It
+// returns astiav.ErrEagain when the graph needs more input before it can
+// produce another output frame.
+func (f *FilterPipeline) PullFrame(frame *astiav.Frame) error {
+	return f.buffersinkCtx.BuffersinkGetFrame(frame, astiav.NewBuffersinkFlags())
+}
+
+// Close releases the filter graph and everything it owns.
+func (f *FilterPipeline) Close() {
+	if f == nil {
+		return
+	}
+	f.graph.Free()
+}
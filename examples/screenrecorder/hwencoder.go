@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"log"
+
+	"github.com/asticode/go-astiav"
+)
+
+// HWAccelKind identifies a hardware acceleration backend to encode with.
+type HWAccelKind int
+
+const (
+	// HWAccelNone disables hardware acceleration and encodes in software (libx264).
+	HWAccelNone HWAccelKind = iota
+	HWAccelNVENC
+	HWAccelVAAPI
+	HWAccelQSV
+	HWAccelVideoToolbox
+)
+
+// hwAccelSpec bundles the bits that differ between hardware backends: the
+// encoder name to look up, the device type to open, and the hw pixel format
+// frames are uploaded into.
+type hwAccelSpec struct {
+	encoderName string
+	deviceType  astiav.HardwareDeviceType
+	hwPixelFmt  astiav.PixelFormat
+}
+
+func hwAccelSpecFor(kind HWAccelKind) (hwAccelSpec, error) {
+	switch kind {
+	case HWAccelNVENC:
+		return hwAccelSpec{"h264_nvenc", astiav.HardwareDeviceTypeCuda, astiav.PixelFormatCuda}, nil
+	case HWAccelVAAPI:
+		return hwAccelSpec{"h264_vaapi", astiav.HardwareDeviceTypeVaapi, astiav.PixelFormatVaapi}, nil
+	case HWAccelQSV:
+		return hwAccelSpec{"h264_qsv", astiav.HardwareDeviceTypeQsv, astiav.PixelFormatQsv}, nil
+	case HWAccelVideoToolbox:
+		return hwAccelSpec{"h264_videotoolbox", astiav.HardwareDeviceTypeVideotoolbox, astiav.PixelFormatVideotoolbox}, nil
+	default:
+		return hwAccelSpec{}, errors.New("unsupported hardware acceleration kind")
+	}
+}
+
+// NewHardwareH264EncoderCodec creates a H264 Encoder Codec and Encoder Codec
+// Context backed by the requested hardware acceleration kind. The returned
+// codec context has a HardwareFramesContext attached, ready to receive
+// frames uploaded via ImageRGBAtoHWFrame. The caller owns, and must Free,
+// both the returned HardwareDeviceContext and HardwareFramesContext.
+func NewHardwareH264EncoderCodec(kind HWAccelKind, width, height, fps int, bitrate int64) (*astiav.Codec, *astiav.CodecContext, *astiav.HardwareDeviceContext, *astiav.HardwareFramesContext, error) {
+	spec, err := hwAccelSpecFor(kind)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	// find the hardware encoder by name, e.g. "h264_nvenc"
+	codec := astiav.FindEncoderByName(spec.encoderName)
+	if codec == nil {
+		log.Println("Error finding hardware h264 encoder:", spec.encoderName)
+		return nil, nil, nil, nil, errors.New("error finding hardware h264 encoder: " + spec.encoderName)
+	}
+
+	// allocate codec context
+	codecCtx := astiav.AllocCodecContext(codec)
+	if codecCtx == nil {
+		log.Println("Error allocating hardware codec context")
+		return nil, nil, nil, nil, errors.New("error allocating hardware codec context")
+	}
+	// !! DO NOT DEFER codecCtx.Free() here, because we will return it
+	//    we don't want to free memory for it here, or it will be set to null
+	//    free it in a higher level function after using it
+
+	// create the hardware device context (for VAAPI, defaults to the first render node)
+	// !! DO NOT DEFER deviceCtx.Free() here either, for the same reason
+	deviceCtx, err := astiav.CreateHardwareDeviceContext(spec.deviceType, "/dev/dri/renderD128", nil, 0)
+	if err != nil {
+		log.Println("Error creating hardware device context:", err)
+		codecCtx.Free()
+		return nil, nil, nil, nil, err
+	}
+
+	// allocate a hardware frames context from the device, with a software
+	// pixel format frames are uploaded from and the backend's hw format
+	framesCtx, err := deviceCtx.AllocHardwareFramesContext()
+	if err != nil {
+		log.Println("Error allocating hardware frames context:", err)
+		deviceCtx.Free()
+		codecCtx.Free()
+		return nil, nil, nil, nil, err
+	}
+	framesCtx.SetWidth(width)
+	framesCtx.SetHeight(height)
+	framesCtx.SetSoftwarePixelFormat(astiav.PixelFormatNv12)
+	framesCtx.SetPixelFormat(spec.hwPixelFmt)
+
+	if err := framesCtx.Init(); err != nil {
+		log.Println("Error initializing hardware frames context:", err)
+		framesCtx.Free()
+		deviceCtx.Free()
+		codecCtx.Free()
+		return nil, nil, nil, nil, err
+	}
+
+	// set codec context parameters
+	codecCtx.SetWidth(width)
+	codecCtx.SetHeight(height)
+	codecCtx.SetFramerate(astiav.NewRational(fps, 1))
+	codecCtx.SetTimeBase(astiav.NewRational(1, 90*1000))
+	codecCtx.SetPixelFormat(spec.hwPixelFmt)
+	codecCtx.SetBitRate(bitrate)
+	codecCtx.SetFlags(codecCtx.Flags().Add(astiav.CodecContextFlagGlobalHeader))
+
+	// attach the hardware device and frames contexts to the codec context
+	// before Open, as required for hardware encoders
+	codecCtx.SetHardwareDeviceContext(deviceCtx)
+	codecCtx.SetHardwareFramesContext(framesCtx)
+
+	return codec, codecCtx, deviceCtx, framesCtx, nil
+}
+
+// ImageRGBAtoHWFrame turns a software NV12 frame (as produced by
+// ImageRGBAtoNV12Frame) into a hardware frame ready for SendFrame: it
+// allocates a hw frame from the frames pool and uploads swFrame into it via
+// TransferData. It does no scaling or pixel format conversion itself.
+func ImageRGBAtoHWFrame(framesCtx *astiav.HardwareFramesContext, swFrame *astiav.Frame) (*astiav.Frame, error) {
+	hwFrame := astiav.AllocFrame()
+	// !! DO NOT DEFER hwFrame.Free() here, because we will return it
+	//    we don't want to free memory for it here, or it will be set to null
+	//    free it in a higher level function after using it
+
+	if err := framesCtx.GetBuffer(hwFrame); err != nil {
+		log.Println("Error getting buffer from hardware frames context:", err)
+		hwFrame.Free()
+		return nil, err
+	}
+
+	// upload the software NV12 frame into GPU memory
+	if err := hwFrame.TransferData(swFrame, 0); err != nil {
+		log.Println("Error transferring frame data to hardware:", err)
+		hwFrame.Free()
+		return nil, err
+	}
+
+	return hwFrame, nil
+}
+
+// ImageRGBAtoNV12Frame sws-scales an image.RGBA directly into a software
+// NV12 frame, the intermediate step ImageRGBAtoHWFrame uploads from. It
+// mirrors ImageRGBAtoAVFrame but targets NV12 instead of YUV420P, since
+// that's the software pixel format hardware frame pools expect.
+func ImageRGBAtoNV12Frame(img *image.RGBA, width, height int) (*astiav.Frame, error) {
+	// create a source frame holding the raw RGBA pixels
+	srcFrame := astiav.AllocFrame()
+	defer srcFrame.Free()
+
+	srcFrame.SetWidth(img.Bounds().Dx())
+	srcFrame.SetHeight(img.Bounds().Dy())
+	srcFrame.SetPixelFormat(astiav.PixelFormatRgba)
+
+	if err := srcFrame.AllocBuffer(1); err != nil {
+		log.Println("Error allocating srcFrame frame buffer:", err)
+		return nil, err
+	}
+	if err := srcFrame.MakeWritable(); err != nil {
+		log.Println("Error making srcFrame frame writable:", err)
+		return nil, err
+	}
+	if err := srcFrame.Data().FromImage(img); err != nil {
+		log.Println("Error copying image into frame:", err)
+		return nil, err
+	}
+
+	nv12Frame := astiav.AllocFrame()
+	// !! DO NOT DEFER nv12Frame.Free() here, because we will return it
+	//    we don't want to free memory for it here, or it will be set to null
+	//    free it in a higher level function after using it
+
+	nv12Frame.SetWidth(width)
+	nv12Frame.SetHeight(height)
+	nv12Frame.SetPixelFormat(astiav.PixelFormatNv12)
+
+	if err := nv12Frame.AllocBuffer(1); err != nil {
+		log.Println("Error allocating NV12 frame buffer:", err)
+		nv12Frame.Free()
+		return nil, err
+	}
+
+	swsCtx, err := astiav.CreateSoftwareScaleContext(
+		srcFrame.Width(), srcFrame.Height(), astiav.PixelFormatRgba,
+		width, height, astiav.PixelFormatNv12,
+		astiav.NewSoftwareScaleContextFlags(astiav.SoftwareScaleContextFlagBilinear),
+	)
+	if err != nil {
+		log.Println("Error creating sws context:", err)
+		nv12Frame.Free()
+		return nil, err
+	}
+	defer swsCtx.Free()
+
+	if err := swsCtx.ScaleFrame(srcFrame, nv12Frame); err != nil {
+		log.Println("Error scaling frame to NV12:", err)
+		nv12Frame.Free()
+		return nil, err
+	}
+
+	return nv12Frame, nil
+}
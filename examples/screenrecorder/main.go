@@ -7,36 +7,96 @@ import (
 	"image"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/asticode/go-astiav"
-	"github.com/kbinani/screenshot"
+)
+
+const (
+	audioSampleRate = 44100
+	audioChannels   = 2
 )
 
 func main() {
 	fmt.Println("Starting Screen recording...")
-	// Get the screen resolution
-	bounds := screenshot.GetDisplayBounds(0)
-	StartScreenRecording("output.mp4", bounds.Dx(), bounds.Dy(), 30)
+	captureOpts := CaptureOptions{Displays: []int{0}, DrawCursor: true}
+	StartScreenRecording(FileTarget{Path: "output.mp4"}, captureOpts, 30, HWAccelNone, "")
 }
 
-func StartScreenRecording(filename string, width, height, fps int) {
+// StartScreenRecording records the screen to target, which may be a local
+// file or a streaming protocol (see OutputTarget). captureOpts controls
+// which display(s), region and cursor/diffing behavior StartScreenCap uses;
+// the encoder's width/height are derived from it via ResolvedBounds. hwKind
+// picks a hardware acceleration backend to encode with (HWAccelNone for
+// software libx264); if creating the requested hardware backend fails, it
+// falls back to software encoding. filterDesc is an optional libavfilter
+// chain (ffmpeg -vf syntax, e.g. "drawtext=text='%{localtime}'") run on
+// every captured frame before it's sent to the encoder; an empty string
+// skips filtering. filterDesc applies to software encoding only: when a
+// hardware encoder is in use it is ignored.
+func StartScreenRecording(target OutputTarget, captureOpts CaptureOptions, fps int, hwKind HWAccelKind, filterDesc string) {
 	SetupFFmpeg()
 
-	// create output format context (output file container)
-	outputCtx, err := astiav.AllocOutputFormatContext(nil, "", filename)
+	// shared monotonic start time both video and audio PTS derive from, so
+	// lip-sync holds across pauses in the screen capture loop
+	startTime := time.Now()
+
+	width, height, err := captureOpts.ResolvedBounds()
 	if err != nil {
-		fmt.Println("Error creating output format context:", err)
+		fmt.Println("Error resolving capture bounds:", err)
 		return
 	}
-	defer outputCtx.Free()
 
-	// create an Encoder Codec and Encoder Codec Context
-	enc, encCtx, err := NewH264EncoderCodec(width, height, fps, outputCtx.BitRate())
+	// create output format context (output file container). the muxer name
+	// is picked by the target; an empty name lets ffmpeg guess it from the URL
+	outputCtx, err := astiav.AllocOutputFormatContext(nil, target.FormatName(), target.URL())
 	if err != nil {
-		fmt.Println("Error creating encoder codec context:", err)
+		fmt.Println("Error creating output format context:", err)
 		return
 	}
+	defer outputCtx.Free()
+
+	// create an Encoder Codec and Encoder Codec Context, preferring the
+	// requested hardware backend and falling back to software on failure
+	var enc *astiav.Codec
+	var encCtx *astiav.CodecContext
+	var deviceCtx *astiav.HardwareDeviceContext
+	var framesCtx *astiav.HardwareFramesContext
+	if hwKind != HWAccelNone {
+		enc, encCtx, deviceCtx, framesCtx, err = NewHardwareH264EncoderCodec(hwKind, width, height, fps, outputCtx.BitRate())
+		if err != nil {
+			fmt.Println("Error creating hardware encoder, falling back to software:", err)
+		}
+	}
+	if encCtx == nil {
+		enc, encCtx, err = NewH264EncoderCodec(width, height, fps, outputCtx.BitRate())
+		if err != nil {
+			fmt.Println("Error creating encoder codec context:", err)
+			return
+		}
+	}
 	defer encCtx.Free()
+	if deviceCtx != nil {
+		defer deviceCtx.Free()
+	}
+	if framesCtx != nil {
+		defer framesCtx.Free()
+	}
+
+	// keep keyframes roughly 2 seconds apart so HLS/DASH segments stay seekable
+	encCtx.SetGopSize(fps * 2)
+
+	// build the pre-encode filter pipeline for the software path; the
+	// hardware path uploads straight from an NV12 frame and isn't filtered
+	var filterPipeline *FilterPipeline
+	if framesCtx == nil {
+		filterPipeline, err = NewFilterPipeline(filterDesc, width, height, astiav.PixelFormatYuv420P, astiav.PixelFormatYuv420P, encCtx.TimeBase())
+		if err != nil {
+			fmt.Println("Error creating filter pipeline:", err)
+			return
+		}
+		defer filterPipeline.Close()
+	}
 
 	// add a new video stream to the output context
 	videoStream := outputCtx.NewStream(enc)
@@ -60,18 +120,60 @@ func StartScreenRecording(filename string, width, height, fps int) {
 	// set stream timebase
 	videoStream.SetTimeBase(encCtx.TimeBase())
 
-	// write output format ctx as streams have been configured
-	// as we are writing to a file we need to provide an io context
-	var ioCtx *astiav.IOContext
-	if ioCtx, err = astiav.OpenIOContext(filename, astiav.NewIOContextFlags(astiav.IOContextFlagWrite)); err != nil {
-		fmt.Println("Error opening IO context:", err)
+	// create an AAC Encoder Codec and Encoder Codec Context for the audio track
+	aenc, aencCtx, err := NewAACEncoderCodec(audioSampleRate, audioChannels, 128*1000)
+	if err != nil {
+		fmt.Println("Error creating audio encoder codec context:", err)
+		return
+	}
+	defer aencCtx.Free()
+
+	// add a new audio stream to the output context
+	audioStream := outputCtx.NewStream(aenc)
+	if audioStream == nil {
+		fmt.Println("Error creating new audio stream")
+		return
+	}
+
+	// open audio codec context
+	if err = aencCtx.Open(aenc, nil); err != nil {
+		fmt.Println("Error opening audio codec context:", err)
+		return
+	}
+
+	// update audio stream params from codec context
+	if err = audioStream.CodecParameters().FromCodecContext(aencCtx); err != nil {
+		fmt.Println("Error updating audio stream params:", err)
+		return
+	}
+
+	// set audio stream timebase
+	audioStream.SetTimeBase(aencCtx.TimeBase())
+
+	// build the resample/FIFO state used to repack audio capture chunks
+	// into fixed frame_size frames before they're sent to the encoder
+	audioState, err := newAudioEncoderState(aencCtx, audioSampleRate, audioChannels, startTime)
+	if err != nil {
+		fmt.Println("Error creating audio encoder state:", err)
 		return
 	}
-	defer ioCtx.Free()
-	// assign the io context to the output context
-	outputCtx.SetPb(ioCtx)
-	// write output format header
-	if err = outputCtx.WriteHeader(nil); err != nil {
+	defer audioState.close()
+
+	// write output format ctx as streams have been configured.
+	// file, RTMP (flv) and UDP (mpegts) targets need an explicit io context;
+	// the rtsp and hls muxers manage their own I/O
+	if target.NeedsIOContext() {
+		var ioCtx *astiav.IOContext
+		if ioCtx, err = astiav.OpenIOContext(target.URL(), astiav.NewIOContextFlags(astiav.IOContextFlagWrite)); err != nil {
+			fmt.Println("Error opening IO context:", err)
+			return
+		}
+		defer ioCtx.Free()
+		// assign the io context to the output context
+		outputCtx.SetPb(ioCtx)
+	}
+	// write output format header, passing along any muxer-private options
+	if err = outputCtx.WriteHeader(target.Options()); err != nil {
 		fmt.Println("Error writing header:", err)
 		return
 	}
@@ -89,80 +191,171 @@ func StartScreenRecording(filename string, width, height, fps int) {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT)
 	defer stop()
 
-	// make a channel to recv images
+	// make channels to recv images and audio samples
 	imgChan := make(chan *image.RGBA)
+	audioChan := make(chan *AudioSample)
 
 	// Start Screen Capture
 	go func() {
-		if err := StartScreenCap(ctx, fps, imgChan); err != nil {
+		if err := StartScreenCap(ctx, fps, captureOpts, imgChan); err != nil {
 			fmt.Println("Error capturing screen:", err)
 			return
 		}
 	}()
 
-	// PTS Increment
-	// for a 90kHz timebase freq, and 60fps
-	// PTS = Frame Number × (90*1000 ÷ 60) = 1 * (90000 ÷ 60) = 1500
-	pts := int64((90 * 1000) / fps)
-	frameNumber := int64(0)
-
-	// encode and write frames
-	for {
-		select {
-		case <-ctx.Done():
+	// Start Audio Capture
+	go func() {
+		if err := StartAudioCap(ctx, audioSampleRate, audioChannels, audioChan); err != nil {
+			fmt.Println("Error capturing audio:", err)
 			return
-		case img := <-imgChan:
-			// create frame from image
-			frame, err := ImageRGBAtoAVFrame(img)
+		}
+	}()
+
+	// encode and write video frames
+	encodeVideoFrame := func(img *image.RGBA) error {
+		var frame *astiav.Frame
+		if framesCtx != nil {
+			// hardware path: scale RGBA -> NV12 directly from the captured
+			// image, then upload it into a hw frame from the pool
+			nv12Frame, err := ImageRGBAtoNV12Frame(img, width, height)
 			if err != nil {
-				fmt.Println("error creating frame from image:", err)
-				defer ctx.Done()
-				return
+				return fmt.Errorf("error creating NV12 frame from image: %w", err)
 			}
+			defer nv12Frame.Free()
 
-			// set frame pts
-			frame.SetPts(frameNumber * pts)
+			frame, err = ImageRGBAtoHWFrame(framesCtx, nv12Frame)
+			if err != nil {
+				return fmt.Errorf("error uploading frame to hardware: %w", err)
+			}
 
-			// send frame for encoding
-			if err := encCtx.SendFrame(frame); err != nil {
-				fmt.Println("error sending frame for encoding:", err)
-				defer ctx.Done()
-				return
+			// derive PTS from the shared monotonic clock, in the encoder's
+			// 90kHz timebase, so lip-sync holds across capture pauses. The
+			// filtered path below stamps its input frame the same way before
+			// it enters the graph, and leaves the output frames' PTS as the
+			// graph (fps/setpts) sets them.
+			frame.SetPts(int64(time.Since(startTime) / time.Microsecond * 90 / 1000))
+		} else {
+			// capture -> filter pipeline -> encoder, so any user-supplied
+			// filter description (drawtext, crop, scale, fps, ...) applies
+			// transparently
+			rawFrame, err := ImageRGBAtoAVFrame(img)
+			if err != nil {
+				return fmt.Errorf("error creating frame from image: %w", err)
 			}
+			defer rawFrame.Free()
 
-			// increment frame number
-			frameNumber++
+			// set the input PTS before it enters the graph: filters like fps
+			// (frame duplication/drop) and setpts need real per-frame input
+			// timestamps to make their timing decisions
+			rawFrame.SetPts(int64(time.Since(startTime) / time.Microsecond * 90 / 1000))
 
-			// create a packet to store encoded data
-			packet := astiav.AllocPacket()
-			if packet == nil {
-				fmt.Println("error allocating packet")
-				defer ctx.Done()
-				return
+			if err := filterPipeline.PushFrame(rawFrame); err != nil {
+				return fmt.Errorf("error pushing frame into filter pipeline: %w", err)
+			}
+
+			frame = astiav.AllocFrame()
+			if err := filterPipeline.PullFrame(frame); err != nil {
+				frame.Free()
+				if errors.Is(err, astiav.ErrEagain) {
+					// graph needs more input before it can produce a frame
+					return nil
+				}
+				return fmt.Errorf("error pulling frame from filter pipeline: %w", err)
+			}
+		}
+		defer frame.Free()
+
+		// send frame for encoding
+		if err := encCtx.SendFrame(frame); err != nil {
+			return fmt.Errorf("error sending frame for encoding: %w", err)
+		}
+
+		// create a packet to store encoded data
+		packet := astiav.AllocPacket()
+		if packet == nil {
+			return errors.New("error allocating packet")
+		}
+		defer packet.Free()
+
+		// encode packet
+		for {
+			err := encCtx.ReceivePacket(packet)
+			if errors.Is(err, astiav.ErrEof) || errors.Is(err, astiav.ErrEagain) {
+				break
+			} else if err != nil {
+				return fmt.Errorf("error encoding packet: %w", err)
+			}
+
+			// rescale packet timestamp from codec timebase to stream timebase
+			packet.RescaleTs(encCtx.TimeBase(), videoStream.TimeBase())
+			packet.SetStreamIndex(videoStream.Index())
+
+			// write packet to output context, interleaved with the audio stream
+			if err = outputCtx.WriteInterleavedFrame(packet); err != nil {
+				return fmt.Errorf("error writing video packet: %w", err)
+			}
+		}
+
+		return nil
+	}
+
+	// repack and encode audio samples
+	encodeAudioSample := func(sample *AudioSample) error {
+		if err := audioState.push(sample); err != nil {
+			return fmt.Errorf("error pushing audio sample into fifo: %w", err)
+		}
+
+		for {
+			frame, err := audioState.pullFrame()
+			if err != nil {
+				return fmt.Errorf("error pulling audio frame from fifo: %w", err)
+			}
+			if frame == nil {
+				return nil
+			}
+
+			// send frame for encoding
+			if err := aencCtx.SendFrame(frame); err != nil {
+				frame.Free()
+				return fmt.Errorf("error sending audio frame for encoding: %w", err)
 			}
-			defer packet.Free()
+			frame.Free()
 
 			// encode packet
 			for {
-				err := encCtx.ReceivePacket(packet)
+				err := aencCtx.ReceivePacket(audioState.pkt)
 				if errors.Is(err, astiav.ErrEof) || errors.Is(err, astiav.ErrEagain) {
 					break
 				} else if err != nil {
-					fmt.Println("error encoding packet:", err)
-					defer ctx.Done()
-					return
+					return fmt.Errorf("error encoding audio packet: %w", err)
 				}
 
 				// rescale packet timestamp from codec timebase to stream timebase
-				packet.RescaleTs(encCtx.TimeBase(), videoStream.TimeBase())
+				audioState.pkt.RescaleTs(aencCtx.TimeBase(), audioStream.TimeBase())
+				audioState.pkt.SetStreamIndex(audioStream.Index())
 
-				// write packet to output context
-				if err = outputCtx.WriteFrame(packet); err != nil {
-					fmt.Println("error writing packet:", err)
-					defer ctx.Done()
-					return
+				// write packet to output context, interleaved with the video stream
+				if err = outputCtx.WriteInterleavedFrame(audioState.pkt); err != nil {
+					return fmt.Errorf("error writing audio packet: %w", err)
 				}
 			}
 		}
 	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case img := <-imgChan:
+			if err := encodeVideoFrame(img); err != nil {
+				fmt.Println(err)
+				return
+			}
+		case sample := <-audioChan:
+			if err := encodeAudioSample(sample); err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+	}
 }
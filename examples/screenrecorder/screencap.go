@@ -1,26 +1,85 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"image"
+	"image/draw"
 	"log"
 	"time"
-	
+
+	"github.com/go-vgo/robotgo"
 	"github.com/kbinani/screenshot"
 )
 
+// CaptureOptions configures what StartScreenCap captures and how.
+type CaptureOptions struct {
+	// Displays lists the display indices to capture. When more than one is
+	// given, their captures are composited side-by-side into a single
+	// image, left to right in the order given. Defaults to []int{0}.
+	Displays []int
+	// Region, if non-nil, crops the composited capture to this sub-rectangle
+	// before it's sent on the channel.
+	Region *image.Rectangle
+	// DrawCursor overlays the current OS cursor position onto the captured
+	// image before sending it.
+	DrawCursor bool
+	// ChangedRegionsOnly skips sending frames that are pixel-identical to
+	// the previous one, to reduce bitrate on mostly-static screens. No frame
+	// is re-sent for a skipped tick; the previous frame simply lasts until
+	// the next changed frame's PTS.
+	ChangedRegionsOnly bool
+}
+
+// ResolvedBounds returns the width and height of the image StartScreenCap
+// will produce for these options, so callers can size the encoder (e.g.
+// StartScreenRecording) correctly before capture starts.
+func (o CaptureOptions) ResolvedBounds() (width, height int, err error) {
+	displays := o.Displays
+	if len(displays) == 0 {
+		displays = []int{0}
+	}
+
+	for _, d := range displays {
+		b := screenshot.GetDisplayBounds(d)
+		if b.Dx() == 0 || b.Dy() == 0 {
+			return 0, 0, errors.New("error resolving bounds for display")
+		}
+		width += b.Dx()
+		if b.Dy() > height {
+			height = b.Dy()
+		}
+	}
+
+	if o.Region != nil {
+		width, height = o.Region.Dx(), o.Region.Dy()
+	}
+
+	return width, height, nil
+}
+
 // StartScreenCap Starts Streaming Screenshots to an image.RGBA channel
-func StartScreenCap(ctx context.Context, fps int, imgChan chan<- *image.RGBA) error {
+func StartScreenCap(ctx context.Context, fps int, opts CaptureOptions, imgChan chan<- *image.RGBA) error {
+	displays := opts.Displays
+	if len(displays) == 0 {
+		displays = []int{0}
+	}
+
+	displayBounds := make([]image.Rectangle, len(displays))
+	for i, d := range displays {
+		displayBounds[i] = screenshot.GetDisplayBounds(d)
+	}
+
 	// Calculate the time to wait between each frame
 	waitTime := time.Second / time.Duration(fps)
 
-	// Get Screen Resolution
-	res := screenshot.GetDisplayBounds(0)
-
 	// create a fps ticker
 	ticker := time.NewTicker(waitTime)
 	defer ticker.Stop()
 
+	var prev *image.RGBA
+
 	// Start the screenshot loop
 	for {
 		select {
@@ -28,14 +87,101 @@ func StartScreenCap(ctx context.Context, fps int, imgChan chan<- *image.RGBA) er
 			log.Println("Screenshot Stream Stopped")
 			return nil
 		case <-ticker.C:
-			img, err := screenshot.CaptureRect(res)
+			img, err := captureComposite(displays, displayBounds)
 			if err != nil {
 				log.Println("Error capturing screenshot:", err)
 				return err
 			}
 
+			if opts.DrawCursor {
+				drawCursor(img, displayBounds)
+			}
+
+			if opts.Region != nil {
+				img = cropImage(img, *opts.Region)
+			}
+
+			if opts.ChangedRegionsOnly && prev != nil && bytes.Equal(img.Pix, prev.Pix) {
+				// unchanged since the last frame, skip it: nothing is sent
+				// for this tick, so the previous frame lasts until the next
+				// frame's PTS; no frame is re-sent in its place
+				continue
+			}
+			prev = img
+
 			// forwards the image to the channel
 			imgChan <- img
 		}
 	}
 }
+
+// captureComposite captures every requested display and, if there's more
+// than one, composites them side-by-side into a single image.
+func captureComposite(displays []int, bounds []image.Rectangle) (*image.RGBA, error) {
+	if len(displays) == 1 {
+		return screenshot.CaptureRect(bounds[0])
+	}
+
+	width, maxHeight := 0, 0
+	for _, b := range bounds {
+		width += b.Dx()
+		if b.Dy() > maxHeight {
+			maxHeight = b.Dy()
+		}
+	}
+
+	composite := image.NewRGBA(image.Rect(0, 0, width, maxHeight))
+
+	offsetX := 0
+	for i, d := range displays {
+		shot, err := screenshot.CaptureRect(bounds[i])
+		if err != nil {
+			return nil, err
+		}
+		draw.Draw(composite, image.Rect(offsetX, 0, offsetX+bounds[i].Dx(), bounds[i].Dy()), shot, image.Point{}, draw.Src)
+		offsetX += bounds[i].Dx()
+		_ = d
+	}
+
+	return composite, nil
+}
+
+// cropImage returns the sub-rectangle of img described by region.
+func cropImage(img *image.RGBA, region image.Rectangle) *image.RGBA {
+	cropped := image.NewRGBA(image.Rect(0, 0, region.Dx(), region.Dy()))
+	draw.Draw(cropped, cropped.Bounds(), img, region.Min, draw.Src)
+	return cropped
+}
+
+// drawCursor queries the current OS cursor position and blits a small
+// crosshair onto img at the matching composited coordinates, skipping
+// displays the cursor isn't currently over.
+func drawCursor(img *image.RGBA, displayBounds []image.Rectangle) {
+	x, y := robotgo.Location()
+
+	offsetX := 0
+	for _, b := range displayBounds {
+		if image.Pt(x, y).In(b) {
+			blitCursor(img, offsetX+(x-b.Min.X), y-b.Min.Y)
+			return
+		}
+		offsetX += b.Dx()
+	}
+}
+
+// blitCursor draws a small white crosshair centered on (x, y).
+func blitCursor(img *image.RGBA, x, y int) {
+	const size = 6
+	white := image.NewUniform(image.White)
+	for d := -size; d <= size; d++ {
+		setPixel(img, x+d, y, white)
+		setPixel(img, x, y+d, white)
+	}
+}
+
+func setPixel(img *image.RGBA, x, y int, src image.Image) {
+	if !image.Pt(x, y).In(img.Bounds()) {
+		return
+	}
+	draw.Draw(img, image.Rect(x, y, x+1, y+1), src, image.Point{}, draw.Src)
+}
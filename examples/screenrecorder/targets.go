@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/asticode/go-astiav"
+)
+
+// OutputTarget abstracts where StartScreenRecording writes its muxed
+// output: a local file, or a streaming protocol handling its own I/O.
+type OutputTarget interface {
+	// FormatName is the muxer short name passed as AllocOutputFormatContext's
+	// format argument, e.g. "flv", "rtsp", "hls", "mpegts". An empty string
+	// lets ffmpeg guess the muxer from the URL, as file targets do.
+	FormatName() string
+	// URL is the output URL or file path passed to AllocOutputFormatContext.
+	URL() string
+	// Options returns muxer-private options (e.g. hls_time, rtsp_transport)
+	// to pass to WriteHeader, or nil if there are none.
+	Options() *astiav.Dictionary
+	// NeedsIOContext reports whether the target requires an explicit
+	// IOContext opened via OpenIOContext. Targets whose muxer manages its own
+	// I/O (rtsp, hls) must not have one attached; file, RTMP (flv) and UDP
+	// (mpegts) targets need one.
+	NeedsIOContext() bool
+}
+
+// FileTarget writes the muxed output to a local file, guessing the muxer
+// from the file extension (e.g. ".mp4").
+type FileTarget struct {
+	Path string
+}
+
+func (t FileTarget) FormatName() string         { return "" }
+func (t FileTarget) URL() string                { return t.Path }
+func (t FileTarget) Options() *astiav.Dictionary { return nil }
+func (t FileTarget) NeedsIOContext() bool        { return true }
+
+// RTMPTarget streams flv-muxed output to an RTMP server, e.g.
+// "rtmp://localhost/live/stream".
+type RTMPTarget struct {
+	Addr string
+}
+
+func (t RTMPTarget) FormatName() string         { return "flv" }
+func (t RTMPTarget) URL() string                { return t.Addr }
+func (t RTMPTarget) Options() *astiav.Dictionary { return nil }
+
+// NeedsIOContext is true: unlike rtsp/hls, the flv muxer doesn't manage its
+// own I/O (it's not an AVFMT_NOFILE muxer) and needs an explicit IOContext.
+func (t RTMPTarget) NeedsIOContext() bool { return true }
+
+// RTSPTarget streams rtsp-muxed output, e.g. "rtsp://localhost:8554/stream".
+// TCP forces the rtsp_transport option to "tcp" instead of the default udp.
+type RTSPTarget struct {
+	Addr string
+	TCP  bool
+}
+
+func (t RTSPTarget) FormatName() string { return "rtsp" }
+func (t RTSPTarget) URL() string        { return t.Addr }
+func (t RTSPTarget) Options() *astiav.Dictionary {
+	if !t.TCP {
+		return nil
+	}
+	d := astiav.NewDictionary()
+	d.Set("rtsp_transport", "tcp", astiav.NewDictionaryFlags())
+	return d
+}
+func (t RTSPTarget) NeedsIOContext() bool { return false }
+
+// HLSTarget writes an HLS playlist and its media segments next to
+// PlaylistPath. SegmentTime is the target segment duration in seconds and
+// ListSize is the number of segments kept in the live playlist (0 keeps all).
+type HLSTarget struct {
+	PlaylistPath string
+	SegmentTime  int
+	ListSize     int
+}
+
+func (t HLSTarget) FormatName() string { return "hls" }
+func (t HLSTarget) URL() string        { return t.PlaylistPath }
+func (t HLSTarget) Options() *astiav.Dictionary {
+	d := astiav.NewDictionary()
+	if t.SegmentTime > 0 {
+		d.Set("hls_time", strconv.Itoa(t.SegmentTime), astiav.NewDictionaryFlags())
+	}
+	d.Set("hls_list_size", strconv.Itoa(t.ListSize), astiav.NewDictionaryFlags())
+	return d
+}
+func (t HLSTarget) NeedsIOContext() bool { return false }
+
+// UDPTarget streams mpegts-muxed output over UDP, e.g.
+// "udp://239.0.0.1:1234".
+type UDPTarget struct {
+	Addr string
+}
+
+func (t UDPTarget) FormatName() string         { return "mpegts" }
+func (t UDPTarget) URL() string                { return t.Addr }
+func (t UDPTarget) Options() *astiav.Dictionary { return nil }
+
+// NeedsIOContext is true: like flv, the mpegts muxer is not AVFMT_NOFILE and
+// needs an explicit IOContext to write to the UDP socket.
+func (t UDPTarget) NeedsIOContext() bool { return true }
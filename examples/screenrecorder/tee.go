@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/asticode/go-astiav"
+)
+
+// RungConfig describes one branch of a TeeEncoder's bitrate ladder: the
+// resolution and bitrate to encode at, and where to send the result.
+type RungConfig struct {
+	Width, Height int
+	FPS           int
+	Bitrate       int64
+	Target        OutputTarget
+}
+
+// rung holds everything one bitrate-ladder branch needs to scale, encode
+// and mux its own copy of the incoming frames, independently of the others.
+type rung struct {
+	cfg       RungConfig
+	swsCtx    *astiav.SoftwareScaleContext
+	codecCtx  *astiav.CodecContext
+	outputCtx *astiav.FormatContext
+	stream    *astiav.Stream
+	pkt       *astiav.Packet
+	ioCtx     *astiav.IOContext
+	frameChan chan *image.RGBA
+}
+
+// TeeEncoder drives one screen-capture source into multiple simultaneous
+// encoders at different resolutions/bitrates (e.g. for adaptive streaming),
+// each writing to its own OutputTarget.
+type TeeEncoder struct {
+	rungs []*rung
+	// wg tracks the runRung goroutines so Close can wait for them to drain
+	// and stop touching a rung's cgo-backed contexts before freeing them
+	wg sync.WaitGroup
+}
+
+// NewTeeEncoder builds a TeeEncoder with one rung per config: an output
+// format context, H264 encoder and software scale context, all set up and
+// ready to receive frames via Run. srcWidth/srcHeight are the resolution of
+// the frames that will be fed to Run (the native capture resolution), used
+// to size each rung's scale context correctly regardless of its own target
+// resolution.
+func NewTeeEncoder(srcWidth, srcHeight int, configs []RungConfig) (*TeeEncoder, error) {
+	te := &TeeEncoder{}
+
+	for _, cfg := range configs {
+		r, err := newRung(srcWidth, srcHeight, cfg)
+		if err != nil {
+			te.Close()
+			return nil, err
+		}
+		te.rungs = append(te.rungs, r)
+	}
+
+	return te, nil
+}
+
+func newRung(srcWidth, srcHeight int, cfg RungConfig) (*rung, error) {
+	outputCtx, err := astiav.AllocOutputFormatContext(nil, cfg.Target.FormatName(), cfg.Target.URL())
+	if err != nil {
+		return nil, fmt.Errorf("error creating output format context for rung %dx%d: %w", cfg.Width, cfg.Height, err)
+	}
+
+	codec, codecCtx, err := NewH264EncoderCodec(cfg.Width, cfg.Height, cfg.FPS, cfg.Bitrate)
+	if err != nil {
+		outputCtx.Free()
+		return nil, err
+	}
+	// keep keyframes roughly 2 seconds apart so segmented outputs stay seekable
+	codecCtx.SetGopSize(cfg.FPS * 2)
+
+	stream := outputCtx.NewStream(codec)
+	if stream == nil {
+		codecCtx.Free()
+		outputCtx.Free()
+		return nil, errors.New("error creating new stream for rung")
+	}
+
+	if err := codecCtx.Open(codec, nil); err != nil {
+		codecCtx.Free()
+		outputCtx.Free()
+		return nil, err
+	}
+
+	if err := stream.CodecParameters().FromCodecContext(codecCtx); err != nil {
+		codecCtx.Free()
+		outputCtx.Free()
+		return nil, err
+	}
+	stream.SetTimeBase(codecCtx.TimeBase())
+
+	var ioCtx *astiav.IOContext
+	if cfg.Target.NeedsIOContext() {
+		ioCtx, err = astiav.OpenIOContext(cfg.Target.URL(), astiav.NewIOContextFlags(astiav.IOContextFlagWrite))
+		if err != nil {
+			codecCtx.Free()
+			outputCtx.Free()
+			return nil, err
+		}
+		outputCtx.SetPb(ioCtx)
+	}
+
+	if err := outputCtx.WriteHeader(cfg.Target.Options()); err != nil {
+		if ioCtx != nil {
+			ioCtx.Free()
+		}
+		codecCtx.Free()
+		outputCtx.Free()
+		return nil, err
+	}
+
+	swsCtx, err := astiav.CreateSoftwareScaleContext(
+		srcWidth, srcHeight, astiav.PixelFormatRgba,
+		cfg.Width, cfg.Height, astiav.PixelFormatYuv420P,
+		astiav.NewSoftwareScaleContextFlags(astiav.SoftwareScaleContextFlagBilinear),
+	)
+	if err != nil {
+		if ioCtx != nil {
+			ioCtx.Free()
+		}
+		codecCtx.Free()
+		outputCtx.Free()
+		return nil, err
+	}
+
+	return &rung{
+		cfg:       cfg,
+		swsCtx:    swsCtx,
+		codecCtx:  codecCtx,
+		outputCtx: outputCtx,
+		stream:    stream,
+		pkt:       astiav.AllocPacket(),
+		ioCtx:     ioCtx,
+		// bounded so a slow encoder applies back-pressure by dropping
+		// frames instead of stalling the other rungs
+		frameChan: make(chan *image.RGBA, 2),
+	}, nil
+}
+
+// Run fans out every frame received on imgChan to all rungs concurrently,
+// aligning PTS on a shared monotonic clock, until ctx is cancelled.
+func (t *TeeEncoder) Run(ctx context.Context, imgChan <-chan *image.RGBA) {
+	startTime := time.Now()
+
+	for _, r := range t.rungs {
+		t.wg.Add(1)
+		go t.runRung(ctx, r, startTime)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case img := <-imgChan:
+			for _, r := range t.rungs {
+				select {
+				case r.frameChan <- img:
+				default:
+					// rung is falling behind, drop this frame for it rather
+					// than stalling the other rungs
+					log.Printf("tee: dropping frame for rung %dx%d, encoder is falling behind\n", r.cfg.Width, r.cfg.Height)
+				}
+			}
+		}
+	}
+}
+
+func (t *TeeEncoder) runRung(ctx context.Context, r *rung, startTime time.Time) {
+	defer t.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case img := <-r.frameChan:
+			if err := t.encodeRungFrame(r, img, startTime); err != nil {
+				log.Printf("tee: error encoding frame for rung %dx%d: %v\n", r.cfg.Width, r.cfg.Height, err)
+				return
+			}
+		}
+	}
+}
+
+func (t *TeeEncoder) encodeRungFrame(r *rung, img *image.RGBA, startTime time.Time) error {
+	srcFrame := astiav.AllocFrame()
+	defer srcFrame.Free()
+
+	srcFrame.SetWidth(img.Bounds().Dx())
+	srcFrame.SetHeight(img.Bounds().Dy())
+	srcFrame.SetPixelFormat(astiav.PixelFormatRgba)
+	if err := srcFrame.AllocBuffer(1); err != nil {
+		return err
+	}
+	if err := srcFrame.MakeWritable(); err != nil {
+		return err
+	}
+	if err := srcFrame.Data().FromImage(img); err != nil {
+		return err
+	}
+
+	scaledFrame := astiav.AllocFrame()
+	defer scaledFrame.Free()
+
+	scaledFrame.SetWidth(r.cfg.Width)
+	scaledFrame.SetHeight(r.cfg.Height)
+	scaledFrame.SetPixelFormat(astiav.PixelFormatYuv420P)
+	if err := scaledFrame.AllocBuffer(1); err != nil {
+		return err
+	}
+
+	// reuse this rung's sws context across frames instead of allocating one each time
+	if err := r.swsCtx.ScaleFrame(srcFrame, scaledFrame); err != nil {
+		return err
+	}
+
+	scaledFrame.SetPts(int64(time.Since(startTime) / time.Microsecond * 90 / 1000))
+
+	if err := r.codecCtx.SendFrame(scaledFrame); err != nil {
+		return err
+	}
+
+	for {
+		err := r.codecCtx.ReceivePacket(r.pkt)
+		if errors.Is(err, astiav.ErrEof) || errors.Is(err, astiav.ErrEagain) {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		r.pkt.RescaleTs(r.codecCtx.TimeBase(), r.stream.TimeBase())
+		r.pkt.SetStreamIndex(r.stream.Index())
+
+		if err := r.outputCtx.WriteInterleavedFrame(r.pkt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close writes each rung's trailer and releases its resources. Call after
+// Run's context has been cancelled; it waits for the runRung goroutines to
+// finish before freeing anything they might still be using.
+func (t *TeeEncoder) Close() {
+	t.wg.Wait()
+
+	for _, r := range t.rungs {
+		if err := r.outputCtx.WriteTrailer(); err != nil {
+			log.Printf("tee: error writing trailer for rung %dx%d: %v\n", r.cfg.Width, r.cfg.Height, err)
+		}
+		r.pkt.Free()
+		r.swsCtx.Free()
+		r.codecCtx.Free()
+		if r.ioCtx != nil {
+			r.ioCtx.Free()
+		}
+		r.outputCtx.Free()
+	}
+}